@@ -0,0 +1,198 @@
+package edit
+
+import (
+	"fmt"
+	"strings"
+
+	"../eval"
+)
+
+// KeyBindings maps, for each mode, the keys bound in that mode to the name
+// of the leBuiltins entry they invoke. Editors sharing an *eval.Evaluator
+// share a KeyBindings too (see bindingStateFor), so that rebinding persists
+// across the Editor being recreated; Editors on different Evaluators never
+// see each other's rebinds.
+type KeyBindings map[bufferMode]map[Key]string
+
+// bindingState holds the bindings and closures customized via bind/unbind,
+// keyed by the *eval.Evaluator they were made on. Init reattaches an
+// Editor to the bindingState for its ev instead of starting fresh from
+// defaultBindings every time, so that bind calls made in an rc script (or
+// interactively) survive the Editor being recreated whenever control of
+// the terminal passes back to the line editor.
+type bindingState struct {
+	bindings KeyBindings
+	closures map[bufferMode]map[Key]eval.Callable
+}
+
+var perEvaluatorBindings = map[*eval.Evaluator]*bindingState{}
+
+// bindingStateFor returns the persistent bindingState for ev, creating one
+// seeded from defaultBindings the first time ev is seen.
+func bindingStateFor(ev *eval.Evaluator) *bindingState {
+	if bs, ok := perEvaluatorBindings[ev]; ok {
+		return bs
+	}
+	bs := &bindingState{
+		bindings: KeyBindings(defaultBindings).copy(),
+		closures: map[bufferMode]map[Key]eval.Callable{},
+	}
+	perEvaluatorBindings[ev] = bs
+	return bs
+}
+
+// copy returns a deep copy of kb, so mutating the result never affects kb
+// itself.
+func (kb KeyBindings) copy() KeyBindings {
+	out := make(KeyBindings, len(kb))
+	for mode, bindings := range kb {
+		inner := make(map[Key]string, len(bindings))
+		for k, v := range bindings {
+			inner[k] = v
+		}
+		out[mode] = inner
+	}
+	return out
+}
+
+var modeNames = map[string]bufferMode{
+	"insert": ModeInsert,
+	"command": ModeCommand,
+	"completing": ModeCompleting,
+	"history": ModeHistory,
+	"history-search": ModeHistorySearch,
+}
+
+var namedKeys = map[string]rune{
+	"Enter": Enter,
+	"Tab": Tab,
+	"Backspace": Backspace,
+	"Up": Up,
+	"Down": Down,
+	"Left": Left,
+	"Right": Right,
+}
+
+// parseKeySpec parses a key spec such as "Ctrl-R", "Alt-x" or "Enter" into
+// a Key.
+func parseKeySpec(spec string) (Key, error) {
+	var mod Mod
+	for {
+		switch {
+		case strings.HasPrefix(spec, "Ctrl-"):
+			mod |= Ctrl
+			spec = spec[len("Ctrl-"):]
+		case strings.HasPrefix(spec, "Alt-"):
+			mod |= Alt
+			spec = spec[len("Alt-"):]
+		default:
+			goto done
+		}
+	}
+	done:
+	if r, ok := namedKeys[spec]; ok {
+		return Key{r, mod}, nil
+	}
+	runes := []rune(spec)
+	if len(runes) != 1 {
+		return Key{}, fmt.Errorf("bad key spec: %q", spec)
+	}
+	return Key{runes[0], mod}, nil
+}
+
+// Bind rebinds key in mode to action, which is either the name of a
+// registered leBuiltins entry or an elvish closure. A closure is kept in
+// ed.closures, never in the global leBuiltins table; ed.closures is shared
+// by the Editors on the same *eval.Evaluator (see bindingStateFor), so
+// Editors on different Evaluators never clobber each other's closures.
+func Bind(ed *Editor, mode bufferMode, key Key, action eval.Value) error {
+	if name, ok := action.(eval.String); ok {
+		if _, ok := leBuiltins[string(name)]; !ok {
+			return fmt.Errorf("no such builtin: %s", name)
+		}
+		if ed.bindings[mode] == nil {
+			ed.bindings[mode] = map[Key]string{}
+		}
+		ed.bindings[mode][key] = string(name)
+		delete(ed.closures[mode], key)
+		return nil
+	}
+	closure, ok := action.(eval.Callable)
+	if !ok {
+		return fmt.Errorf("action must be a builtin name or closure")
+	}
+	if ed.closures[mode] == nil {
+		ed.closures[mode] = map[Key]eval.Callable{}
+	}
+	ed.closures[mode][key] = closure
+	delete(ed.bindings[mode], key)
+	return nil
+}
+
+// Unbind removes any binding (builtin or closure) for key in mode, so
+// lookups fall back to DefaultBinding.
+func Unbind(ed *Editor, mode bufferMode, key Key) {
+	delete(ed.bindings[mode], key)
+	delete(ed.closures[mode], key)
+}
+
+// Bindings returns the bindings currently in effect for mode, naming
+// closure bindings "<closure>" since they have no leBuiltins entry.
+func (ed *Editor) Bindings(mode bufferMode) map[Key]string {
+	out := make(map[Key]string, len(ed.bindings[mode])+len(ed.closures[mode]))
+	for key, name := range ed.bindings[mode] {
+		out[key] = name
+	}
+	for key := range ed.closures[mode] {
+		out[key] = "<closure>"
+	}
+	return out
+}
+
+// installBindCommands registers the bind/unbind/bindings builtins on ev,
+// closing over ed so that a user's rc script can rebind keys before the
+// first ReadLine.
+func installBindCommands(ed *Editor, ev *eval.Evaluator) {
+	ev.Builtins["bind"] = func(args []eval.Value) error {
+		if len(args) != 3 {
+			return fmt.Errorf("usage: bind mode key action")
+		}
+		mode, ok := modeNames[string(args[0].(eval.String))]
+		if !ok {
+			return fmt.Errorf("no such mode: %s", args[0])
+		}
+		key, err := parseKeySpec(string(args[1].(eval.String)))
+		if err != nil {
+			return err
+		}
+		return Bind(ed, mode, key, args[2])
+	}
+	ev.Builtins["unbind"] = func(args []eval.Value) error {
+		if len(args) != 2 {
+			return fmt.Errorf("usage: unbind mode key")
+		}
+		mode, ok := modeNames[string(args[0].(eval.String))]
+		if !ok {
+			return fmt.Errorf("no such mode: %s", args[0])
+		}
+		key, err := parseKeySpec(string(args[1].(eval.String)))
+		if err != nil {
+			return err
+		}
+		Unbind(ed, mode, key)
+		return nil
+	}
+	ev.Builtins["bindings"] = func(args []eval.Value) error {
+		if len(args) != 1 {
+			return fmt.Errorf("usage: bindings mode")
+		}
+		mode, ok := modeNames[string(args[0].(eval.String))]
+		if !ok {
+			return fmt.Errorf("no such mode: %s", args[0])
+		}
+		for key, name := range ed.Bindings(mode) {
+			fmt.Fprintf(ed.file, "%v: %s\n", key, name)
+		}
+		return nil
+	}
+}
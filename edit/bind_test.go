@@ -0,0 +1,31 @@
+package edit
+
+import "testing"
+
+func TestParseKeySpec(t *testing.T) {
+	cases := []struct {
+		spec string
+		want Key
+	}{
+		{"a", Key{'a', 0}},
+		{"Enter", Key{Enter, 0}},
+		{"Tab", Key{Tab, 0}},
+		{"Ctrl-R", Key{'R', Ctrl}},
+		{"Alt-x", Key{'x', Alt}},
+		{"Ctrl-Alt-Left", Key{Left, Ctrl | Alt}},
+	}
+	for _, c := range cases {
+		got, err := parseKeySpec(c.spec)
+		if err != nil {
+			t.Errorf("parseKeySpec(%q) returned error: %s", c.spec, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("parseKeySpec(%q) = %v, want %v", c.spec, got, c.want)
+		}
+	}
+
+	if _, err := parseKeySpec("NotAKey"); err == nil {
+		t.Errorf("parseKeySpec(%q) should have returned an error", "NotAKey")
+	}
+}
@@ -0,0 +1,77 @@
+package edit
+
+import "unicode/utf8"
+
+// consumeCount returns the pending repeat count for a motion or operator,
+// defaulting to 1 when none was typed, and resets the count so it does not
+// leak into the next action.
+func (ed *Editor) consumeCount() int {
+	n := ed.count
+	if !ed.countGiven || n == 0 {
+		n = 1
+	}
+	ed.count = 0
+	ed.countGiven = false
+	return n
+}
+
+// digitArgument accumulates a digit (1-9, or 0 once a count has started)
+// into the pending count, e.g. the "4" then "2" of "42w".
+func digitArgument(ed *Editor, k Key) *leReturn {
+	ed.count = ed.count*10 + int(k.Rune-'0')
+	ed.countGiven = true
+	return nil
+}
+
+// digitOrBOL implements vim's overload of "0": with no count typed yet it
+// moves the dot to the beginning of the line, otherwise it is the next
+// digit of a count already in progress.
+func digitOrBOL(ed *Editor, k Key) *leReturn {
+	if !ed.countGiven {
+		ed.dot = 0
+		return nil
+	}
+	return digitArgument(ed, k)
+}
+
+// clearCount discards any partially entered count, e.g. on Esc.
+func clearCount(ed *Editor, k Key) *leReturn {
+	ed.count = 0
+	ed.countGiven = false
+	return nil
+}
+
+// moveDotB moves the dot back by the pending count runes (1 by default).
+func moveDotB(ed *Editor, k Key) *leReturn {
+	for i, n := 0, ed.consumeCount(); i < n && ed.dot > 0; i++ {
+		_, size := utf8.DecodeLastRuneInString(ed.line[:ed.dot])
+		ed.dot -= size
+	}
+	return nil
+}
+
+// moveDotF moves the dot forward by the pending count runes (1 by
+// default).
+func moveDotF(ed *Editor, k Key) *leReturn {
+	for i, n := 0, ed.consumeCount(); i < n && ed.dot < len(ed.line); i++ {
+		_, size := utf8.DecodeRuneInString(ed.line[ed.dot:])
+		ed.dot += size
+	}
+	return nil
+}
+
+// countAccumulatingActions names the leBuiltins entries that build up
+// ed.count rather than consume or ignore it, so ReadLine's dispatch loop
+// knows not to clear the count right after calling them.
+var countAccumulatingActions = map[string]bool{
+	"digit-argument": true,
+	"digit-or-bol": true,
+}
+
+func init() {
+	leBuiltins["digit-argument"] = digitArgument
+	leBuiltins["digit-or-bol"] = digitOrBOL
+	leBuiltins["clear-count"] = clearCount
+	leBuiltins["move-dot-b"] = moveDotB
+	leBuiltins["move-dot-f"] = moveDotF
+}
@@ -0,0 +1,78 @@
+package edit
+
+import "testing"
+
+func TestConsumeCountDefaultsToOne(t *testing.T) {
+	var ed Editor
+	if n := ed.consumeCount(); n != 1 {
+		t.Errorf("consumeCount() with no count given = %d, want 1", n)
+	}
+}
+
+func TestConsumeCountResets(t *testing.T) {
+	var ed Editor
+	ed.count = 4
+	ed.countGiven = true
+
+	if n := ed.consumeCount(); n != 4 {
+		t.Errorf("consumeCount() = %d, want 4", n)
+	}
+	if ed.count != 0 || ed.countGiven {
+		t.Errorf("consumeCount() left count = %d, countGiven = %v, want 0, false", ed.count, ed.countGiven)
+	}
+	if n := ed.consumeCount(); n != 1 {
+		t.Errorf("consumeCount() after reset = %d, want 1", n)
+	}
+}
+
+func TestConsumeCountIgnoresExplicitZero(t *testing.T) {
+	var ed Editor
+	ed.count = 0
+	ed.countGiven = true
+
+	if n := ed.consumeCount(); n != 1 {
+		t.Errorf("consumeCount() with count 0 = %d, want 1", n)
+	}
+}
+
+func TestDigitArgumentAccumulates(t *testing.T) {
+	var ed Editor
+
+	digitArgument(&ed, Key{'4', 0})
+	digitArgument(&ed, Key{'2', 0})
+
+	if !ed.countGiven || ed.count != 42 {
+		t.Errorf("after digitArgument('4'),('2'): count = %d, countGiven = %v, want 42, true", ed.count, ed.countGiven)
+	}
+}
+
+func TestDigitOrBOLMovesDotWithNoCount(t *testing.T) {
+	var ed Editor
+	ed.line = "hello"
+	ed.dot = 3
+
+	digitOrBOL(&ed, Key{'0', 0})
+
+	if ed.dot != 0 {
+		t.Errorf("digitOrBOL() with no count given left dot = %d, want 0", ed.dot)
+	}
+	if ed.countGiven {
+		t.Errorf("digitOrBOL() with no count given set countGiven = true")
+	}
+}
+
+func TestDigitOrBOLContinuesCount(t *testing.T) {
+	var ed Editor
+	ed.dot = 3
+	ed.count = 1
+	ed.countGiven = true
+
+	digitOrBOL(&ed, Key{'0', 0})
+
+	if ed.dot != 3 {
+		t.Errorf("digitOrBOL() with a count in progress moved dot to %d, want 3", ed.dot)
+	}
+	if ed.count != 10 {
+		t.Errorf("digitOrBOL() with a count in progress left count = %d, want 10", ed.count)
+	}
+}
@@ -18,6 +18,8 @@ const (
 	ModeInsert bufferMode = iota
 	ModeCommand
 	ModeCompleting
+	ModeHistory
+	ModeHistorySearch
 )
 
 type editorState struct {
@@ -28,6 +30,31 @@ type editorState struct {
 	tips []string
 	mode bufferMode
 	completion *completion
+
+	// State used by the history (ModeHistory) and history search
+	// (ModeHistorySearch) modes. savedLine preserves ed.line so it can be
+	// restored when the user cancels a history search, or moves Down past
+	// the newest entry in ModeHistory.
+	savedLine string
+	historyIndex int
+	historySearch string
+
+	// pendingRegister names the register the next yank/paste/delete should
+	// use; it is consumed (reset to 0) as soon as that action runs.
+	pendingRegister byte
+	awaitingRegister bool
+
+	// registers holds the kill/yank registers. It lives on editorState
+	// (rather than Editor) per design, but ReadLine never resets it, so
+	// its contents persist across ReadLine calls for the Editor's
+	// lifetime.
+	registers registers
+
+	// count accumulates the pending repeat count for the next ModeCommand
+	// motion or operator, e.g. the "4" of "4w". countGiven distinguishes
+	// "no count typed yet" from an explicit leading 0.
+	count int
+	countGiven bool
 }
 
 func (bs *editorState) finish() {
@@ -42,11 +69,14 @@ func (bs *editorState) finish() {
 
 // Editor keeps the status of the line editor.
 type Editor struct {
-	savedTermios *tty.Termios
+	term tty.Terminal
 	file *os.File
 	writer *writer
 	reader *reader
 	ev *eval.Evaluator
+	history *history
+	bindings KeyBindings
+	closures map[bufferMode]map[Key]eval.Callable
 	editorState
 }
 
@@ -62,63 +92,56 @@ type LineRead struct {
 // The Editor is reinitialized every time the control of the terminal is
 // transferred back to the line editor.
 func Init(file *os.File, tr *util.TimedReader, ev *eval.Evaluator) (*Editor, error) {
-	fd := int(file.Fd())
-	term, err := tty.NewTermiosFromFd(fd)
+	term, err := tty.Open(file)
 	if err != nil {
-		return nil, fmt.Errorf("Can't get terminal attribute: %s", err)
+		return nil, fmt.Errorf("Can't open terminal: %s", err)
 	}
 
+	hist, err := newHistory(historyFileName())
+	if err != nil {
+		return nil, fmt.Errorf("Can't load command history: %s", err)
+	}
+
+	bs := bindingStateFor(ev)
 	editor := &Editor{
-		savedTermios: term.Copy(),
+		term: term,
 		file: file,
 		writer: newWriter(file),
-		reader: newReader(tr),
+		reader: newReader(term),
 		ev: ev,
+		history: hist,
+		bindings: bs.bindings,
+		closures: bs.closures,
 	}
 
-	term.SetIcanon(false)
-	term.SetEcho(false)
-	term.SetMin(1)
-	term.SetTime(0)
+	installBindCommands(editor, ev)
 
-	err = term.ApplyToFd(fd)
-	if err != nil {
+	if err := term.SetRaw(true); err != nil {
 		return nil, fmt.Errorf("Can't set up terminal attribute: %s", err)
 	}
 
 	fmt.Fprint(editor.file, "\033[?7l")
 
-	err = tty.FlushInput(fd)
-	if err != nil {
-		return nil, err
-	}
-
-	file.WriteString("\033[6n")
-	// XXX Possible race condition: user input sneaked in between WriteString
-	// and readCPR
-	x, _, err := editor.reader.readCPR()
+	_, col, err := term.QueryCursorPos()
 	if err != nil {
 		return nil, err
 	}
 
-	if x != 1 {
+	if col != 1 {
 		file.WriteString(Lackeol)
 	}
 
 	return editor, nil
 }
 
-// Cleanup restores the terminal referenced by fd so that other commands
-// that use the terminal can be executed.
+// Cleanup restores the terminal so that other commands that use it can be
+// executed.
 func (ed *Editor) Cleanup() error {
 	fmt.Fprint(ed.file, "\033[?7h")
 
-	fd := int(ed.file.Fd())
-	err := ed.savedTermios.ApplyToFd(fd)
-	if err != nil {
+	if err := ed.term.Restore(); err != nil {
 		return fmt.Errorf("Can't restore terminal attribute of stdin: %s", err)
 	}
-	ed.savedTermios = nil
 	return nil
 }
 
@@ -141,13 +164,29 @@ func (ed *Editor) refresh() error {
 	return ed.writer.refresh(&ed.editorState)
 }
 
-// TODO Allow modifiable keybindings.
-var keyBindings = map[bufferMode]map[Key]string {
+// defaultBindings is copied once per *eval.Evaluator, the first time an
+// Editor is constructed on it; every Editor on that Evaluator then shares
+// the mutable copy that rc scripts can rebind via the bind/unbind builtins
+// (see bindingStateFor in bind.go).
+var defaultBindings = map[bufferMode]map[Key]string {
 	ModeCommand: map[Key]string{
 		Key{'i', 0}: "insert-mode",
 		Key{'h', 0}: "move-dot-b",
 		Key{'l', 0}: "move-dot-f",
 		Key{'D', 0}: "kill-line-f",
+		Key{'"', 0}: "select-register",
+		Key{'p', 0}: "paste-register",
+		Key{'0', 0}: "digit-or-bol",
+		Key{'1', 0}: "digit-argument",
+		Key{'2', 0}: "digit-argument",
+		Key{'3', 0}: "digit-argument",
+		Key{'4', 0}: "digit-argument",
+		Key{'5', 0}: "digit-argument",
+		Key{'6', 0}: "digit-argument",
+		Key{'7', 0}: "digit-argument",
+		Key{'8', 0}: "digit-argument",
+		Key{'9', 0}: "digit-argument",
+		Key{'[', Ctrl}: "clear-count",
 		DefaultBinding: "default-command",
 	},
 	ModeInsert: map[Key]string{
@@ -157,9 +196,12 @@ var keyBindings = map[bufferMode]map[Key]string {
 		Key{Backspace, 0}: "kill-rune-b",
 		Key{Left, 0}: "move-dot-b",
 		Key{Right, 0}: "move-dot-f",
+		Key{Up, 0}: "start-history",
+		Key{'R', Ctrl}: "start-history-search",
 		Key{Enter, 0}: "accept-line",
 		Key{Tab, 0}: "complete",
 		Key{'D', Ctrl}: "return-eof",
+		Key{'Y', Ctrl}: "paste-register",
 		DefaultBinding: "default-insert",
 	},
 	ModeCompleting: map[Key]string{
@@ -169,6 +211,20 @@ var keyBindings = map[bufferMode]map[Key]string {
 		Key{Tab, 0}: "cycle-cand-f",
 		DefaultBinding: "default-completing",
 	},
+	ModeHistory: map[Key]string{
+		Key{Up, 0}: "history-prev",
+		Key{Down, 0}: "history-next",
+		Key{'[', Ctrl}: "history-default",
+		DefaultBinding: "history-default",
+	},
+	ModeHistorySearch: map[Key]string{
+		Key{'R', Ctrl}: "history-search-more",
+		Key{'G', Ctrl}: "history-search-cancel",
+		Key{'[', Ctrl}: "history-search-cancel",
+		Key{Enter, 0}: "history-search-accept",
+		Key{Backspace, 0}: "history-search-backspace",
+		DefaultBinding: "history-search-add",
+	},
 }
 
 // Accpet currently selected completion candidate.
@@ -207,8 +263,19 @@ func (ed *Editor) ReadLine(prompt string, rprompt string) (lr LineRead) {
 			continue
 		}
 
+		if ed.awaitingRegister {
+			ed.awaitingRegister = false
+			ed.pendingRegister = byte(k.Rune)
+			continue
+		}
+
 		lookup_key:
-		keyBinding, ok := keyBindings[ed.mode]
+		if closure, bound := ed.closures[ed.mode][k]; bound {
+			ed.ev.Call(closure, nil)
+			continue
+		}
+
+		keyBinding, ok := ed.bindings[ed.mode]
 		if !ok {
 			ed.pushTip("No binding for current mode")
 			continue
@@ -219,6 +286,15 @@ func (ed *Editor) ReadLine(prompt string, rprompt string) (lr LineRead) {
 			name = keyBinding[DefaultBinding]
 		}
 		ret := leBuiltins[name](ed, k)
+		// Any action other than accumulating a count (digit-argument, or
+		// digit-or-bol once it has started accumulating) ends the count's
+		// life: it either consumed the count already or never looks at
+		// counts at all, and either way a stale count must not leak into
+		// the next, unrelated keystroke.
+		if !countAccumulatingActions[name] {
+			ed.count = 0
+			ed.countGiven = false
+		}
 		if ret == nil {
 			continue
 		}
@@ -232,10 +308,21 @@ func (ed *Editor) ReadLine(prompt string, rprompt string) (lr LineRead) {
 			ed.mode = ret.newMode
 			goto lookup_key
 		case exitReadLine:
+			lr := ret.readLineReturn
+			var historyErr error
+			if lr.Err == nil && !lr.Eof && lr.Line != "" {
+				historyErr = ed.history.append(lr.Line)
+			}
 			ed.finish()
 			ed.refresh() // XXX Ignore possible error
 			fmt.Fprintln(ed.file)
-			return ret.readLineReturn
+			if historyErr != nil {
+				// ed.finish cleared ed.tips, and nothing will refresh
+				// the screen again before the next ReadLine, so report
+				// this straight to the terminal rather than losing it.
+				fmt.Fprintf(ed.file, "Can't save to history: %s\n", historyErr)
+			}
+			return lr
 		}
 	}
 }
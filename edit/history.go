@@ -0,0 +1,198 @@
+package edit
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// history holds the accepted lines of past ReadLine invocations, backed by
+// a file so that it is shared across shell instances and survives restarts.
+type history struct {
+	fname string
+	items []string
+}
+
+// historyFileName returns the path used to persist history. It honors
+// $ELVISH_HISTORY so tests and alternate configurations can override the
+// default of ~/.elvish_history.
+func historyFileName() string {
+	if fname := os.Getenv("ELVISH_HISTORY"); fname != "" {
+		return fname
+	}
+	return os.Getenv("HOME") + "/.elvish_history"
+}
+
+// newHistory loads history from fname, tolerating a missing file.
+func newHistory(fname string) (*history, error) {
+	h := &history{fname: fname}
+
+	f, err := os.Open(fname)
+	if os.IsNotExist(err) {
+		return h, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		h.items = append(h.items, scanner.Text())
+	}
+	return h, scanner.Err()
+}
+
+// append records line as the most recent history entry, both in memory and
+// on disk. A line identical to the immediately preceding one is dropped.
+// The file is opened in append mode and fsynced after every write so that
+// concurrent shell instances can interleave their writes safely.
+func (h *history) append(line string) error {
+	if len(h.items) > 0 && h.items[len(h.items)-1] == line {
+		return nil
+	}
+	h.items = append(h.items, line)
+
+	f, err := os.OpenFile(h.fname, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(line + "\n"); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// find returns the index of the most recent entry before index upto
+// (exclusive) that contains substr, or -1 if there is none.
+func (h *history) find(upto int, substr string) int {
+	if upto > len(h.items) {
+		upto = len(h.items)
+	}
+	for i := upto - 1; i >= 0; i-- {
+		if strings.Contains(h.items[i], substr) {
+			return i
+		}
+	}
+	return -1
+}
+
+// startHistory enters ModeHistory, saving the current line so historyNext
+// can restore it once Down moves past the newest entry, and shows the most
+// recent entry.
+func startHistory(ed *Editor, k Key) *leReturn {
+	ed.savedLine = ed.line
+	ed.historyIndex = len(ed.history.items)
+	historyPrev(ed, k)
+	return &leReturn{action: changeMode, newMode: ModeHistory}
+}
+
+// historyPrev moves to the next older history entry and loads it into the
+// line, leaving the line unchanged if there is no older entry left.
+func historyPrev(ed *Editor, k Key) *leReturn {
+	if i := ed.history.find(ed.historyIndex, ""); i >= 0 {
+		ed.historyIndex = i
+		ed.line = ed.history.items[i]
+		ed.dot = len(ed.line)
+	} else {
+		ed.beep()
+	}
+	return nil
+}
+
+// historyNext moves to the next newer history entry, or back to the line
+// the user was originally editing once the newest entry is passed.
+func historyNext(ed *Editor, k Key) *leReturn {
+	if ed.historyIndex < len(ed.history.items)-1 {
+		ed.historyIndex++
+		ed.line = ed.history.items[ed.historyIndex]
+		ed.dot = len(ed.line)
+	} else {
+		ed.historyIndex = len(ed.history.items)
+		ed.line = ed.savedLine
+		ed.dot = len(ed.line)
+	}
+	return nil
+}
+
+// historyDefault leaves ModeHistory and reprocesses the key that was just
+// read as an ordinary ModeInsert key, e.g. so typing resumes editing at
+// the point the history browsing stopped.
+func historyDefault(ed *Editor, k Key) *leReturn {
+	return &leReturn{action: changeModeAndReprocess, newMode: ModeInsert}
+}
+
+// startHistorySearch enters ModeHistorySearch (Ctrl-R), the
+// "(reverse-i-search)" prompt.
+func startHistorySearch(ed *Editor, k Key) *leReturn {
+	ed.savedLine = ed.line
+	ed.historySearch = ""
+	ed.historyIndex = len(ed.history.items)
+	return &leReturn{action: changeMode, newMode: ModeHistorySearch}
+}
+
+// historySearchAdd appends k's rune to the query and jumps to the newest
+// matching entry.
+func historySearchAdd(ed *Editor, k Key) *leReturn {
+	if k.Mod != 0 || k.Rune < 0 {
+		return nil
+	}
+	ed.historySearch += string(k.Rune)
+	ed.historyIndex = len(ed.history.items)
+	historySearchMore(ed, k)
+	return nil
+}
+
+// historySearchBackspace removes the last rune of the query and re-searches
+// from the newest entry.
+func historySearchBackspace(ed *Editor, k Key) *leReturn {
+	if len(ed.historySearch) == 0 {
+		return nil
+	}
+	runes := []rune(ed.historySearch)
+	ed.historySearch = string(runes[:len(runes)-1])
+	ed.historyIndex = len(ed.history.items)
+	historySearchMore(ed, k)
+	return nil
+}
+
+// historySearchMore (Ctrl-R while already searching) jumps to the next
+// older match for the current query.
+func historySearchMore(ed *Editor, k Key) *leReturn {
+	if i := ed.history.find(ed.historyIndex, ed.historySearch); i >= 0 {
+		ed.historyIndex = i
+		ed.line = ed.history.items[i]
+		ed.dot = len(ed.line)
+	} else {
+		ed.beep()
+	}
+	return nil
+}
+
+// historySearchAccept (Enter) keeps the matched line and returns to
+// ModeInsert.
+func historySearchAccept(ed *Editor, k Key) *leReturn {
+	return &leReturn{action: changeMode, newMode: ModeInsert}
+}
+
+// historySearchCancel (Ctrl-G/Ctrl-[) restores the line as it was before
+// the search started.
+func historySearchCancel(ed *Editor, k Key) *leReturn {
+	ed.line = ed.savedLine
+	ed.dot = len(ed.line)
+	return &leReturn{action: changeMode, newMode: ModeInsert}
+}
+
+func init() {
+	leBuiltins["start-history"] = startHistory
+	leBuiltins["history-prev"] = historyPrev
+	leBuiltins["history-next"] = historyNext
+	leBuiltins["history-default"] = historyDefault
+	leBuiltins["start-history-search"] = startHistorySearch
+	leBuiltins["history-search-add"] = historySearchAdd
+	leBuiltins["history-search-backspace"] = historySearchBackspace
+	leBuiltins["history-search-more"] = historySearchMore
+	leBuiltins["history-search-accept"] = historySearchAccept
+	leBuiltins["history-search-cancel"] = historySearchCancel
+}
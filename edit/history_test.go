@@ -0,0 +1,63 @@
+package edit
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestHistoryAppendDedupsConsecutive(t *testing.T) {
+	f, err := ioutil.TempFile("", "elvish-history-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fname := f.Name()
+	f.Close()
+	defer os.Remove(fname)
+
+	h, err := newHistory(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h.append("ls")
+	h.append("ls")
+	h.append("echo hi")
+	h.append("echo hi")
+	h.append("ls")
+
+	want := []string{"ls", "echo hi", "ls"}
+	if len(h.items) != len(want) {
+		t.Fatalf("got items %v, want %v", h.items, want)
+	}
+	for i := range want {
+		if h.items[i] != want[i] {
+			t.Errorf("items[%d] = %q, want %q", i, h.items[i], want[i])
+		}
+	}
+
+	reloaded, err := newHistory(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reloaded.items) != len(want) {
+		t.Fatalf("after reload: got items %v, want %v", reloaded.items, want)
+	}
+}
+
+func TestHistoryFind(t *testing.T) {
+	h := &history{items: []string{"ls -l", "echo hi", "grep foo bar", "echo bye"}}
+
+	if i := h.find(len(h.items), "echo"); i != 3 {
+		t.Errorf("find(latest, \"echo\") = %d, want 3", i)
+	}
+	if i := h.find(3, "echo"); i != 1 {
+		t.Errorf("find(3, \"echo\") = %d, want 1", i)
+	}
+	if i := h.find(len(h.items), "nonexistent"); i != -1 {
+		t.Errorf("find(latest, \"nonexistent\") = %d, want -1", i)
+	}
+	if i := h.find(0, "echo"); i != -1 {
+		t.Errorf("find(0, \"echo\") = %d, want -1", i)
+	}
+}
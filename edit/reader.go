@@ -0,0 +1,57 @@
+package edit
+
+import "./tty"
+
+// reader turns tty.Events from a Terminal into the Keys ReadLine's main
+// loop dispatches on.
+type reader struct {
+	term tty.Terminal
+}
+
+func newReader(term tty.Terminal) *reader {
+	return &reader{term: term}
+}
+
+// readKey blocks for the next keystroke, skipping resize events.
+func (r *reader) readKey() (Key, error) {
+	for {
+		ev, err := r.term.ReadEvent()
+		if err != nil {
+			return Key{}, err
+		}
+		if ev.Resized {
+			continue
+		}
+		return keyFromEvent(ev), nil
+	}
+}
+
+// keyFromEvent converts a tty.Event into the Key value the POSIX and
+// Windows backends are meant to agree on.
+func keyFromEvent(ev tty.Event) Key {
+	var mod Mod
+	if ev.Mod&tty.Ctrl != 0 {
+		mod |= Ctrl
+	}
+	if ev.Mod&tty.Alt != 0 {
+		mod |= Alt
+	}
+
+	switch ev.Special {
+	case tty.Up:
+		return Key{Up, mod}
+	case tty.Down:
+		return Key{Down, mod}
+	case tty.Left:
+		return Key{Left, mod}
+	case tty.Right:
+		return Key{Right, mod}
+	case tty.Backspace:
+		return Key{Backspace, mod}
+	case tty.Enter:
+		return Key{Enter, mod}
+	case tty.Tab:
+		return Key{Tab, mod}
+	}
+	return Key{ev.Rune, mod}
+}
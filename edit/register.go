@@ -0,0 +1,126 @@
+package edit
+
+import "unicode/utf8"
+
+// registers implements the vim-style kill/yank registers: the unnamed
+// register, ten numbered registers that rotate on every kill, and 26
+// lettered registers that can be targeted explicitly.
+type registers struct {
+	unnamed string
+	numbered [10]string
+	lettered [26]string
+}
+
+// kill records text as the result of a kill/delete. It always becomes the
+// new unnamed register and rotates into "0 (oldest "9 dropped); if name
+// selects a lettered register, text also lands there, appending instead of
+// overwriting when name is uppercase.
+func (r *registers) kill(text string, name byte) {
+	for i := 9; i > 0; i-- {
+		r.numbered[i] = r.numbered[i-1]
+	}
+	r.numbered[0] = text
+	r.unnamed = text
+
+	switch {
+	case name >= 'a' && name <= 'z':
+		r.lettered[name-'a'] = text
+	case name >= 'A' && name <= 'Z':
+		r.lettered[name-'A'] += text
+	}
+}
+
+// get returns the contents of the named register, or the unnamed register
+// when name is 0.
+func (r *registers) get(name byte) string {
+	switch {
+	case name == 0:
+		return r.unnamed
+	case name >= '0' && name <= '9':
+		return r.numbered[name-'0']
+	case name >= 'a' && name <= 'z':
+		return r.lettered[name-'a']
+	case name >= 'A' && name <= 'Z':
+		return r.lettered[name-'A']
+	}
+	return ""
+}
+
+// consumeRegister returns and clears the register selected with ", falling
+// back to the unnamed register (0) when none was selected.
+func (ed *Editor) consumeRegister() byte {
+	name := ed.pendingRegister
+	ed.pendingRegister = 0
+	return name
+}
+
+// selectRegister (") arms the next yank/paste/delete to target the
+// register named by the following keystroke.
+func selectRegister(ed *Editor, k Key) *leReturn {
+	ed.awaitingRegister = true
+	return nil
+}
+
+// pasteRegister (p in ModeCommand, Ctrl-Y in ModeInsert) inserts the
+// selected register's contents at the dot.
+func pasteRegister(ed *Editor, k Key) *leReturn {
+	text := ed.registers.get(ed.consumeRegister())
+	ed.line = ed.line[:ed.dot] + text + ed.line[ed.dot:]
+	ed.dot += len(text)
+	return nil
+}
+
+// killLineF kills from the dot to the end of the line into the selected
+// register. In Vim, a count on D deletes (count-1) whole lines past the
+// current one in addition to the rest of the current line; this editor
+// only ever has one line to operate on, so there is nothing for a count
+// greater than 1 to scale into. The count is still consumed (so it does
+// not leak into the next command), and a count other than 1 beeps to
+// tell the user it was ignored rather than silently doing nothing.
+func killLineF(ed *Editor, k Key) *leReturn {
+	if ed.consumeCount() > 1 {
+		ed.beep()
+	}
+	text := ed.line[ed.dot:]
+	ed.line = ed.line[:ed.dot]
+	ed.registers.kill(text, ed.consumeRegister())
+	return nil
+}
+
+// killLineB kills from the beginning of the line to the dot into the
+// selected register.
+func killLineB(ed *Editor, k Key) *leReturn {
+	text := ed.line[:ed.dot]
+	ed.line = ed.line[ed.dot:]
+	ed.dot = 0
+	ed.registers.kill(text, ed.consumeRegister())
+	return nil
+}
+
+// killRuneB kills the count runes (1 by default) before the dot into the
+// selected register. The default bindings map it only to Backspace in
+// ModeInsert, where no count is ever typed.
+func killRuneB(ed *Editor, k Key) *leReturn {
+	end := ed.dot
+	start := end
+	for i, n := 0, ed.consumeCount(); i < n && start > 0; i++ {
+		_, size := utf8.DecodeLastRuneInString(ed.line[:start])
+		start -= size
+	}
+	if start == end {
+		return nil
+	}
+	text := ed.line[start:end]
+	ed.line = ed.line[:start] + ed.line[end:]
+	ed.dot = start
+	ed.registers.kill(text, ed.consumeRegister())
+	return nil
+}
+
+func init() {
+	leBuiltins["select-register"] = selectRegister
+	leBuiltins["paste-register"] = pasteRegister
+	leBuiltins["kill-line-f"] = killLineF
+	leBuiltins["kill-line-b"] = killLineB
+	leBuiltins["kill-rune-b"] = killRuneB
+}
@@ -0,0 +1,68 @@
+package edit
+
+import "testing"
+
+func TestRegistersUnnamedAndNumbered(t *testing.T) {
+	var r registers
+
+	r.kill("one", 0)
+	r.kill("two", 0)
+	r.kill("three", 0)
+
+	if got := r.get(0); got != "three" {
+		t.Errorf("unnamed register = %q, want %q", got, "three")
+	}
+	if got := r.get('0'); got != "three" {
+		t.Errorf("\"0 = %q, want %q", got, "three")
+	}
+	if got := r.get('1'); got != "two" {
+		t.Errorf("\"1 = %q, want %q", got, "two")
+	}
+	if got := r.get('2'); got != "one" {
+		t.Errorf("\"2 = %q, want %q", got, "one")
+	}
+	if got := r.get('3'); got != "" {
+		t.Errorf("\"3 = %q, want empty", got)
+	}
+}
+
+func TestRegistersNumberedRotationDropsOldest(t *testing.T) {
+	var r registers
+
+	for i := 0; i < 11; i++ {
+		r.kill(string(rune('a'+i)), 0)
+	}
+
+	// The 10 most recent kills are "b".."k" (in that order, 0 newest);
+	// "a" (the very first) has rotated out of the numbered registers.
+	want := []byte("kjihgfedcb")
+	for i, w := range want {
+		if got := r.get('0' + byte(i)); got != string(w) {
+			t.Errorf("\"%d = %q, want %q", i, got, string(w))
+		}
+	}
+}
+
+func TestRegistersLettered(t *testing.T) {
+	var r registers
+
+	r.kill("hello ", 'a')
+	if got := r.get('a'); got != "hello " {
+		t.Errorf("\"a = %q, want %q", got, "hello ")
+	}
+
+	// Uppercase appends to the same lowercase register instead of
+	// overwriting it.
+	r.kill("world", 'A')
+	if got := r.get('a'); got != "hello world" {
+		t.Errorf("\"a after append = %q, want %q", got, "hello world")
+	}
+	if got := r.get('A'); got != "hello world" {
+		t.Errorf("\"A = %q, want %q", got, "hello world")
+	}
+
+	// A lettered kill still becomes the new unnamed/numbered register.
+	if got := r.get(0); got != "world" {
+		t.Errorf("unnamed after lettered kill = %q, want %q", got, "world")
+	}
+}
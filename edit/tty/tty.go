@@ -0,0 +1,67 @@
+// package tty abstracts over the console backend so that package edit can
+// drive a raw, event-based terminal the same way on POSIX (via termios)
+// and on Windows (via the console API). Which backend Open returns is
+// chosen by build tag: tty_posix.go on everything but Windows,
+// tty_windows.go on Windows.
+package tty
+
+import "os"
+
+// SpecialKey names a non-printable key that ReadEvent may report instead
+// of a rune.
+type SpecialKey int
+
+const (
+	None SpecialKey = iota
+	Up
+	Down
+	Left
+	Right
+	Backspace
+	Enter
+	Tab
+)
+
+// Mod is a bitmask of modifier keys held down with a Rune or Special key.
+type Mod int
+
+const (
+	Ctrl Mod = 1 << iota
+	Alt
+)
+
+// Event is either a key press (Special != None, or Rune otherwise) or a
+// terminal resize (Resized).
+type Event struct {
+	Special SpecialKey
+	Rune rune
+	Mod Mod
+
+	Resized bool
+	Rows, Cols int
+}
+
+// Terminal is a console put into raw, event-driven mode for the line
+// editor's exclusive use.
+type Terminal interface {
+	// SetRaw puts the terminal into (raw == true) or out of (raw ==
+	// false) the mode ReadEvent requires: no line buffering, no echo,
+	// one event read per keystroke.
+	SetRaw(raw bool) error
+	// Restore undoes whatever SetRaw(true) changed.
+	Restore() error
+	// ReadEvent blocks for the next key press or resize.
+	ReadEvent() (Event, error)
+	// Write emits output, which may be VT escape sequences.
+	Write(p []byte) (int, error)
+	// Size reports the current terminal dimensions.
+	Size() (rows, cols int, err error)
+	// QueryCursorPos reports where the cursor currently is.
+	QueryCursorPos() (row, col int, err error)
+}
+
+// Open returns the Terminal backend appropriate for file, which must refer
+// to an interactive console.
+func Open(file *os.File) (Terminal, error) {
+	return newTerminal(file)
+}
@@ -0,0 +1,243 @@
+// +build !windows
+
+package tty
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	tcIFlush = 0
+	// tcflsh is ioctl TCFLSH (0x540B on Linux); the syscall package does
+	// not export it, unlike TCGETS/TCSETS/TIOCGWINSZ used below.
+	tcflsh = 0x540B
+)
+
+// posixTerminal drives a POSIX tty via termios, reading raw bytes directly
+// off the fd (one byte per Read, never more than it needs) and
+// translating escape sequences into Events itself.
+type posixTerminal struct {
+	file *os.File
+	saved syscall.Termios
+}
+
+func termiosGet(fd uintptr) (syscall.Termios, error) {
+	var term syscall.Termios
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd,
+		syscall.TCGETS, uintptr(unsafe.Pointer(&term)))
+	if errno != 0 {
+		return term, errno
+	}
+	return term, nil
+}
+
+func termiosSet(fd uintptr, term syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd,
+		syscall.TCSETS, uintptr(unsafe.Pointer(&term)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func newTerminal(file *os.File) (Terminal, error) {
+	saved, err := termiosGet(file.Fd())
+	if err != nil {
+		return nil, fmt.Errorf("Can't get terminal attribute: %s", err)
+	}
+	return &posixTerminal{file: file, saved: saved}, nil
+}
+
+func (t *posixTerminal) SetRaw(raw bool) error {
+	if !raw {
+		return t.Restore()
+	}
+	term := t.saved
+	term.Lflag &^= syscall.ICANON | syscall.ECHO
+	term.Cc[syscall.VMIN] = 1
+	term.Cc[syscall.VTIME] = 0
+	return termiosSet(t.file.Fd(), term)
+}
+
+func (t *posixTerminal) Restore() error {
+	return termiosSet(t.file.Fd(), t.saved)
+}
+
+func (t *posixTerminal) Write(p []byte) (int, error) {
+	return t.file.Write(p)
+}
+
+func (t *posixTerminal) Size() (rows, cols int, err error) {
+	var ws struct{ Row, Col, Xpixel, Ypixel uint16 }
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, t.file.Fd(),
+		syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 {
+		return 0, 0, errno
+	}
+	return int(ws.Row), int(ws.Col), nil
+}
+
+// readByte reads exactly one byte off the fd. On a character device in
+// raw mode, Read never returns more bytes than requested, so unlike a
+// buffered reader this never steals bytes that belong to a later read
+// (e.g. the key the user typed right after a cursor-position query).
+func (t *posixTerminal) readByte() (byte, error) {
+	var buf [1]byte
+	for {
+		n, err := t.file.Read(buf[:])
+		if err != nil {
+			return 0, err
+		}
+		if n == 1 {
+			return buf[0], nil
+		}
+	}
+}
+
+// readByteTimeout reads one byte, returning ok == false if none arrives
+// within timeoutDeciseconds (VTIME units of 0.1s). It is used to tell a
+// bare Escape keypress apart from the first byte of an escape sequence.
+func (t *posixTerminal) readByteTimeout(timeoutDeciseconds byte) (b byte, ok bool, err error) {
+	cur, err := termiosGet(t.file.Fd())
+	if err != nil {
+		return 0, false, err
+	}
+	timed := cur
+	timed.Cc[syscall.VMIN] = 0
+	timed.Cc[syscall.VTIME] = timeoutDeciseconds
+	if err := termiosSet(t.file.Fd(), timed); err != nil {
+		return 0, false, err
+	}
+	defer termiosSet(t.file.Fd(), cur)
+
+	var buf [1]byte
+	n, err := t.file.Read(buf[:])
+	if err == io.EOF {
+		// os.File reports a zero-byte read (the VTIME timeout) as io.EOF.
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return buf[0], n == 1, nil
+}
+
+// flushInput discards any input queued on the tty, so a stray keystroke
+// that arrived before Init ran can't be mistaken for a CPR response.
+func (t *posixTerminal) flushInput() error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, t.file.Fd(),
+		tcflsh, uintptr(tcIFlush))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func (t *posixTerminal) QueryCursorPos() (row, col int, err error) {
+	if err := t.flushInput(); err != nil {
+		return 0, 0, err
+	}
+	if _, err := t.file.WriteString("\033[6n"); err != nil {
+		return 0, 0, err
+	}
+	// Response is "\033[<row>;<col>R".
+	if b, err := t.readByte(); err != nil || b != '\033' {
+		return 0, 0, fmt.Errorf("bad CPR response")
+	}
+	if b, err := t.readByte(); err != nil || b != '[' {
+		return 0, 0, fmt.Errorf("bad CPR response")
+	}
+	rowS, err := t.readUntil(';')
+	if err != nil {
+		return 0, 0, err
+	}
+	colS, err := t.readUntil('R')
+	if err != nil {
+		return 0, 0, err
+	}
+	row, err = strconv.Atoi(rowS)
+	if err != nil {
+		return 0, 0, err
+	}
+	col, err = strconv.Atoi(colS)
+	return row, col, err
+}
+
+func (t *posixTerminal) readUntil(delim byte) (string, error) {
+	var s []byte
+	for {
+		b, err := t.readByte()
+		if err != nil {
+			return "", err
+		}
+		if b == delim {
+			return string(s), nil
+		}
+		s = append(s, b)
+	}
+}
+
+func (t *posixTerminal) ReadEvent() (Event, error) {
+	b, err := t.readByte()
+	if err != nil {
+		return Event{}, err
+	}
+
+	switch b {
+	case '\033':
+		return t.readEscapeSequence()
+	case '\r', '\n':
+		return Event{Special: Enter}, nil
+	case '\t':
+		return Event{Special: Tab}, nil
+	case 0x7f, 0x08:
+		return Event{Special: Backspace}, nil
+	}
+
+	if b < 0x20 {
+		// Ctrl-<letter> is encoded on the wire as the letter's code
+		// point with bit 0x40 cleared, e.g. Ctrl-R is 0x12. Report it
+		// as the uppercase letter, matching the Key{'R', Ctrl}-style
+		// bindings in editor.go.
+		return Event{Rune: rune(b | 0x40), Mod: Ctrl}, nil
+	}
+	return Event{Rune: rune(b)}, nil
+}
+
+func (t *posixTerminal) readEscapeSequence() (Event, error) {
+	// Escape sequences (arrow keys, etc.) arrive as a burst of bytes
+	// following ESC; a standalone Escape keypress does not. A short
+	// timeout tells the two apart instead of blocking forever waiting
+	// for a follow-up byte that a bare ESC will never send.
+	b1, ok, err := t.readByteTimeout(1)
+	if err != nil {
+		return Event{}, err
+	}
+	if !ok {
+		return Event{Rune: '[', Mod: Ctrl}, nil
+	}
+	if b1 != '[' && b1 != 'O' {
+		// Alt-<rune>: ESC followed directly by the rune.
+		return Event{Rune: rune(b1), Mod: Alt}, nil
+	}
+	b2, err := t.readByte()
+	if err != nil {
+		return Event{}, err
+	}
+	switch b2 {
+	case 'A':
+		return Event{Special: Up}, nil
+	case 'B':
+		return Event{Special: Down}, nil
+	case 'C':
+		return Event{Special: Right}, nil
+	case 'D':
+		return Event{Special: Left}, nil
+	}
+	return Event{Rune: rune(b2)}, nil
+}
@@ -0,0 +1,459 @@
+// +build windows
+
+package tty
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32 = syscall.NewLazyDLL("kernel32.dll")
+
+	procGetConsoleMode           = kernel32.NewProc("GetConsoleMode")
+	procSetConsoleMode           = kernel32.NewProc("SetConsoleMode")
+	procGetStdHandle             = kernel32.NewProc("GetStdHandle")
+	procReadConsoleInputW        = kernel32.NewProc("ReadConsoleInputW")
+	procGetConsoleScreenBufferInfo = kernel32.NewProc("GetConsoleScreenBufferInfo")
+	procSetConsoleCursorPosition = kernel32.NewProc("SetConsoleCursorPosition")
+	procSetConsoleTextAttribute  = kernel32.NewProc("SetConsoleTextAttribute")
+	procFillConsoleOutputCharacter = kernel32.NewProc("FillConsoleOutputCharacterW")
+	procFillConsoleOutputAttribute = kernel32.NewProc("FillConsoleOutputAttribute")
+)
+
+const (
+	stdOutputHandle = -11
+
+	// Input-mode bits (GetConsoleMode/SetConsoleMode on the input handle).
+	enableEchoInput      = 0x0004
+	enableLineInput      = 0x0002
+	enableProcessedInput = 0x0001
+
+	// Output-mode bit (GetConsoleMode/SetConsoleMode on the output
+	// handle) enabling VT sequence interpretation on Windows 10+. It
+	// shares its numeric value with enableEchoInput above, but the two
+	// only ever apply to different handles.
+	enableVirtualTerminalProcessing = 0x0004
+
+	keyEvent       = 0x0001
+	windowBufferSizeEvent = 0x0004
+
+	vkLeft      = 0x25
+	vkUp        = 0x26
+	vkRight     = 0x27
+	vkDown      = 0x28
+	vkBack      = 0x08
+	vkReturn    = 0x0D
+	vkTab       = 0x09
+
+	leftCtrlPressed  = 0x0008
+	rightCtrlPressed = 0x0004
+	leftAltPressed   = 0x0002
+	rightAltPressed  = 0x0001
+
+	// Console text-attribute color bits (wincon.h).
+	fgBlue      = 0x0001
+	fgGreen     = 0x0002
+	fgRed       = 0x0004
+	fgIntensity = 0x0008
+	bgBlue      = 0x0010
+	bgGreen     = 0x0020
+	bgRed       = 0x0040
+	bgIntensity = 0x0080
+)
+
+// ansiToFg maps the 8 basic ANSI color indices (as used in SGR 30-37/90-97)
+// to the console's foreground RGB bits.
+var ansiToFg = [8]uint16{
+	0, fgRed, fgGreen, fgRed | fgGreen, fgBlue, fgRed | fgBlue, fgGreen | fgBlue, fgRed | fgGreen | fgBlue,
+}
+
+type coord struct{ X, Y int16 }
+type smallRect struct{ Left, Top, Right, Bottom int16 }
+
+type consoleScreenBufferInfo struct {
+	Size              coord
+	CursorPosition    coord
+	Attributes        uint16
+	Window            smallRect
+	MaximumWindowSize coord
+}
+
+// keyEventRecord mirrors Windows' KEY_EVENT_RECORD.
+type keyEventRecord struct {
+	KeyDown         int32
+	RepeatCount     uint16
+	VirtualKeyCode  uint16
+	VirtualScanCode uint16
+	UnicodeChar     uint16
+	ControlKeyState uint32
+}
+
+// inputRecord mirrors Windows' INPUT_RECORD (padded to the KEY_EVENT_RECORD
+// layout, the largest variant we care about).
+type inputRecord struct {
+	EventType uint16
+	_         uint16
+	Event     keyEventRecord
+}
+
+// windowsTerminal drives the Windows console API directly, so the line
+// editor works on cmd.exe/PowerShell without a termios layer. Input
+// events are read from the console's input buffer handle; output (VT
+// sequences, or the direct console-buffer fallback) goes through the
+// separate screen-buffer (output) handle, since GetConsoleMode/
+// SetConsoleMode mode bits mean different things on each.
+type windowsTerminal struct {
+	file *os.File
+	handle syscall.Handle
+	savedInMode uint32
+
+	outHandle syscall.Handle
+	savedOutMode uint32
+	vtOutput bool
+
+	// defaultAttr is the console's text attribute at startup, restored by
+	// an SGR reset (ESC[0m or bare ESC[m) in writeDirect.
+	defaultAttr uint16
+	curAttr uint16
+}
+
+func newTerminal(file *os.File) (Terminal, error) {
+	h := syscall.Handle(file.Fd())
+	var inMode uint32
+	if r, _, err := procGetConsoleMode.Call(uintptr(h), uintptr(unsafe.Pointer(&inMode))); r == 0 {
+		return nil, fmt.Errorf("GetConsoleMode: %s", err)
+	}
+
+	stdOut := int32(stdOutputHandle)
+	outH, _, err := procGetStdHandle.Call(uintptr(uint32(stdOut)))
+	if outH == 0 || outH == uintptr(syscall.InvalidHandle) {
+		return nil, fmt.Errorf("GetStdHandle: %s", err)
+	}
+	outHandle := syscall.Handle(outH)
+	var outMode uint32
+	if r, _, err := procGetConsoleMode.Call(uintptr(outHandle), uintptr(unsafe.Pointer(&outMode))); r == 0 {
+		return nil, fmt.Errorf("GetConsoleMode: %s", err)
+	}
+
+	var info consoleScreenBufferInfo
+	if r, _, err := procGetConsoleScreenBufferInfo.Call(uintptr(outHandle), uintptr(unsafe.Pointer(&info))); r == 0 {
+		return nil, fmt.Errorf("GetConsoleScreenBufferInfo: %s", err)
+	}
+
+	return &windowsTerminal{
+		file: file,
+		handle: h,
+		savedInMode: inMode,
+		outHandle: outHandle,
+		savedOutMode: outMode,
+		defaultAttr: info.Attributes,
+		curAttr: info.Attributes,
+	}, nil
+}
+
+func (t *windowsTerminal) SetRaw(raw bool) error {
+	if !raw {
+		return t.Restore()
+	}
+	mode := t.savedInMode &^ (enableEchoInput | enableLineInput | enableProcessedInput)
+	if r, _, err := procSetConsoleMode.Call(uintptr(t.handle), uintptr(mode)); r == 0 {
+		return fmt.Errorf("SetConsoleMode: %s", err)
+	}
+	// Try to enable VT sequence output on the screen buffer (Windows
+	// 10+); if it fails we fall back to direct console buffer calls in
+	// Write. This never touches the input handle's mode.
+	r, _, _ := procSetConsoleMode.Call(uintptr(t.outHandle), uintptr(t.savedOutMode|enableVirtualTerminalProcessing))
+	t.vtOutput = r != 0
+	return nil
+}
+
+func (t *windowsTerminal) Restore() error {
+	if r, _, err := procSetConsoleMode.Call(uintptr(t.handle), uintptr(t.savedInMode)); r == 0 {
+		return fmt.Errorf("SetConsoleMode: %s", err)
+	}
+	if r, _, err := procSetConsoleMode.Call(uintptr(t.outHandle), uintptr(t.savedOutMode)); r == 0 {
+		return fmt.Errorf("SetConsoleMode: %s", err)
+	}
+	return nil
+}
+
+func (t *windowsTerminal) Write(p []byte) (int, error) {
+	if t.vtOutput {
+		return syscall.Write(t.outHandle, p)
+	}
+	return t.writeDirect(p)
+}
+
+func (t *windowsTerminal) Size() (rows, cols int, err error) {
+	info, err := t.bufferInfo()
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(info.Window.Bottom-info.Window.Top) + 1, int(info.Window.Right-info.Window.Left) + 1, nil
+}
+
+func (t *windowsTerminal) QueryCursorPos() (row, col int, err error) {
+	info, err := t.bufferInfo()
+	if err != nil {
+		return 0, 0, err
+	}
+	// Windows coordinates are 0-based; report 1-based like ANSI CPR.
+	return int(info.CursorPosition.Y) + 1, int(info.CursorPosition.X) + 1, nil
+}
+
+func (t *windowsTerminal) bufferInfo() (consoleScreenBufferInfo, error) {
+	var info consoleScreenBufferInfo
+	r, _, err := procGetConsoleScreenBufferInfo.Call(uintptr(t.outHandle), uintptr(unsafe.Pointer(&info)))
+	if r == 0 {
+		return info, fmt.Errorf("GetConsoleScreenBufferInfo: %s", err)
+	}
+	return info, nil
+}
+
+// writeDirect is the pre-VT fallback: it understands just enough of our
+// own output (cursor positioning, erase-to-end-of-line, and SGR color) to
+// drive the console buffer APIs directly, instead of emitting escape
+// sequences a non-VT console would print as garbage. Plain text runs
+// between escape sequences are passed straight through, since those
+// display fine either way.
+func (t *windowsTerminal) writeDirect(p []byte) (int, error) {
+	total := len(p)
+	for len(p) > 0 {
+		if p[0] != 0x1b {
+			end := 1
+			for end < len(p) && p[end] != 0x1b {
+				end++
+			}
+			if _, err := syscall.Write(t.outHandle, p[:end]); err != nil {
+				return total - len(p), err
+			}
+			p = p[end:]
+			continue
+		}
+
+		seq, rest, ok := splitCSI(p)
+		if !ok {
+			// Not a CSI sequence we understand; drop just the ESC so we
+			// don't loop on it, and keep going.
+			p = p[1:]
+			continue
+		}
+		if err := t.applyCSI(seq); err != nil {
+			return total - len(p), err
+		}
+		p = rest
+	}
+	return total, nil
+}
+
+// splitCSI recognizes "\x1b[<params><final>" at the start of p and
+// returns the final byte and numeric params, plus the remainder of p. ok
+// is false if p does not start with a CSI sequence.
+func splitCSI(p []byte) (seq csiSeq, rest []byte, ok bool) {
+	if len(p) < 3 || p[0] != 0x1b || p[1] != '[' {
+		return csiSeq{}, p, false
+	}
+	i := 2
+	for i < len(p) && (p[i] == ';' || (p[i] >= '0' && p[i] <= '9')) {
+		i++
+	}
+	if i >= len(p) {
+		return csiSeq{}, p, false
+	}
+	params := string(p[2:i])
+	final := p[i]
+	var nums []int
+	if params != "" {
+		start := 0
+		for j := 0; j <= len(params); j++ {
+			if j == len(params) || params[j] == ';' {
+				n, _ := strconv.Atoi(params[start:j])
+				nums = append(nums, n)
+				start = j + 1
+			}
+		}
+	}
+	return csiSeq{final: final, params: nums}, p[i+1:], true
+}
+
+type csiSeq struct {
+	final byte
+	params []int
+}
+
+// param returns the sequence's i'th parameter, or def if it was omitted
+// or given as 0 (ANSI treats a 0 and an absent parameter the same way for
+// the sequences we handle here).
+func (s csiSeq) param(i, def int) int {
+	if i >= len(s.params) || s.params[i] == 0 {
+		return def
+	}
+	return s.params[i]
+}
+
+func (t *windowsTerminal) applyCSI(s csiSeq) error {
+	switch s.final {
+	case 'H', 'f':
+		return t.moveCursor(s.param(0, 1), s.param(1, 1))
+	case 'G':
+		info, err := t.bufferInfo()
+		if err != nil {
+			return err
+		}
+		return t.moveCursor(int(info.CursorPosition.Y-info.Window.Top)+1, s.param(0, 1))
+	case 'K':
+		return t.eraseLine(s.param(0, 0))
+	case 'm':
+		return t.applySGR(s.params)
+	}
+	return nil
+}
+
+// moveCursor sets the cursor to the given 1-based row/col, interpreted
+// relative to the top of the visible window the way ANSI CUP is.
+func (t *windowsTerminal) moveCursor(row, col int) error {
+	info, err := t.bufferInfo()
+	if err != nil {
+		return err
+	}
+	pos := coord{X: info.Window.Left + int16(col-1), Y: info.Window.Top + int16(row-1)}
+	if r, _, err := procSetConsoleCursorPosition.Call(uintptr(t.outHandle), uintptr(uint32(uint16(pos.Y))<<16|uint32(uint16(pos.X)))); r == 0 {
+		return fmt.Errorf("SetConsoleCursorPosition: %s", err)
+	}
+	return nil
+}
+
+// eraseLine implements EL: mode 0 clears from the cursor to the end of
+// the line (the only mode the editor's writer actually emits), 1 clears
+// from the start of the line to the cursor, 2 clears the whole line.
+func (t *windowsTerminal) eraseLine(mode int) error {
+	info, err := t.bufferInfo()
+	if err != nil {
+		return err
+	}
+	width := int(info.Window.Right-info.Window.Left) + 1
+	var start, n int
+	switch mode {
+	case 1:
+		start, n = 0, int(info.CursorPosition.X)+1
+	case 2:
+		start, n = 0, width
+	default:
+		start, n = int(info.CursorPosition.X), width-int(info.CursorPosition.X)
+	}
+	if n <= 0 {
+		return nil
+	}
+	pos := coord{X: int16(start), Y: info.CursorPosition.Y}
+	posArg := uintptr(uint32(uint16(pos.Y))<<16 | uint32(uint16(pos.X)))
+	var written uint32
+	if r, _, err := procFillConsoleOutputCharacter.Call(uintptr(t.outHandle), uintptr(' '), uintptr(n), posArg, uintptr(unsafe.Pointer(&written))); r == 0 {
+		return fmt.Errorf("FillConsoleOutputCharacterW: %s", err)
+	}
+	if r, _, err := procFillConsoleOutputAttribute.Call(uintptr(t.outHandle), uintptr(t.curAttr), uintptr(n), posArg, uintptr(unsafe.Pointer(&written))); r == 0 {
+		return fmt.Errorf("FillConsoleOutputAttribute: %s", err)
+	}
+	return nil
+}
+
+// applySGR translates the subset of SGR parameters the editor actually
+// emits (reset, bold, and the 8 basic foreground/background colors, plain
+// and bright) into a console text attribute.
+func (t *windowsTerminal) applySGR(params []int) error {
+	if len(params) == 0 {
+		params = []int{0}
+	}
+	attr := t.curAttr
+	for _, p := range params {
+		switch {
+		case p == 0:
+			attr = t.defaultAttr
+		case p == 1:
+			attr |= fgIntensity
+		case p >= 30 && p <= 37:
+			attr = attr&^(fgRed|fgGreen|fgBlue|fgIntensity) | ansiToFg[p-30]
+		case p == 39:
+			attr = attr&^(fgRed|fgGreen|fgBlue|fgIntensity) | (t.defaultAttr & (fgRed | fgGreen | fgBlue | fgIntensity))
+		case p >= 40 && p <= 47:
+			attr = attr&^(bgRed|bgGreen|bgBlue|bgIntensity) | ansiToFg[p-40]<<4
+		case p == 49:
+			attr = attr&^(bgRed|bgGreen|bgBlue|bgIntensity) | (t.defaultAttr & (bgRed | bgGreen | bgBlue | bgIntensity))
+		case p >= 90 && p <= 97:
+			attr = attr&^(fgRed|fgGreen|fgBlue|fgIntensity) | ansiToFg[p-90] | fgIntensity
+		case p >= 100 && p <= 107:
+			attr = attr&^(bgRed|bgGreen|bgBlue|bgIntensity) | ansiToFg[p-100]<<4 | bgIntensity
+		}
+	}
+	if r, _, err := procSetConsoleTextAttribute.Call(uintptr(t.outHandle), uintptr(attr)); r == 0 {
+		return fmt.Errorf("SetConsoleTextAttribute: %s", err)
+	}
+	t.curAttr = attr
+	return nil
+}
+
+func (t *windowsTerminal) ReadEvent() (Event, error) {
+	for {
+		var rec inputRecord
+		var n uint32
+		r, _, err := procReadConsoleInputW.Call(uintptr(t.handle),
+			uintptr(unsafe.Pointer(&rec)), 1, uintptr(unsafe.Pointer(&n)))
+		if r == 0 {
+			return Event{}, fmt.Errorf("ReadConsoleInputW: %s", err)
+		}
+
+		switch rec.EventType {
+		case keyEvent:
+			if rec.Event.KeyDown == 0 {
+				continue
+			}
+			return keyEventToEvent(rec.Event), nil
+		case windowBufferSizeEvent:
+			rows, cols, err := t.Size()
+			if err != nil {
+				return Event{}, err
+			}
+			return Event{Resized: true, Rows: rows, Cols: cols}, nil
+		}
+	}
+}
+
+func keyEventToEvent(k keyEventRecord) Event {
+	mod := Mod(0)
+	if k.ControlKeyState&(leftCtrlPressed|rightCtrlPressed) != 0 {
+		mod |= Ctrl
+	}
+	if k.ControlKeyState&(leftAltPressed|rightAltPressed) != 0 {
+		mod |= Alt
+	}
+
+	switch k.VirtualKeyCode {
+	case vkLeft:
+		return Event{Special: Left, Mod: mod}
+	case vkRight:
+		return Event{Special: Right, Mod: mod}
+	case vkUp:
+		return Event{Special: Up, Mod: mod}
+	case vkDown:
+		return Event{Special: Down, Mod: mod}
+	case vkBack:
+		return Event{Special: Backspace, Mod: mod}
+	case vkReturn:
+		return Event{Special: Enter, Mod: mod}
+	case vkTab:
+		return Event{Special: Tab, Mod: mod}
+	}
+
+	r := rune(k.UnicodeChar)
+	if mod&Ctrl != 0 && r > 0 && r < 0x20 {
+		// Windows reports Ctrl-<letter> as the same C0 control code as
+		// the wire byte POSIX terminals send (e.g. Ctrl-R is 0x12); fold
+		// it back to the uppercase letter so both backends produce the
+		// same Key.
+		r |= 0x40
+	}
+	return Event{Rune: r, Mod: mod}
+}